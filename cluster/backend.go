@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// BackendType names a cluster.Backend implementation. No function in this
+// package builds a Backend from a BackendType: each implementation is built
+// with its own constructor (NewEtcdV3Backend, NewConsulBackend, NewLibkvBackend).
+type BackendType string
+
+const (
+	// BackendEtcdV3 selects the native etcd v3 backend (clientv3 + concurrency).
+	BackendEtcdV3 BackendType = "etcdv3"
+	// BackendEtcdV2 selects the legacy etcd v2 backend, served through the libkv shim.
+	BackendEtcdV2 BackendType = "etcdv2"
+	// BackendConsul selects the native Consul backend (session-based locks/election).
+	BackendConsul BackendType = "consul"
+)
+
+// Locker is a distributed, TTL-backed mutual exclusion lock. It mirrors
+// docker/libkv's store.Locker so the libkv shim can satisfy it directly.
+type Locker interface {
+	// Lock blocks until the lock is acquired or stopCh is closed.
+	Lock(stopCh chan struct{}) (<-chan struct{}, error)
+	// Unlock releases the lock.
+	Unlock() error
+}
+
+// Election coordinates leader election on top of a backend lease or session.
+// Its shape follows etcd's clientv3/concurrency.Election so the etcd v3
+// implementation is a thin pass-through.
+type Election interface {
+	// Campaign blocks until this node becomes leader, ctx is cancelled, or an error occurs.
+	Campaign(ctx context.Context) error
+	// Resign gives up leadership voluntarily.
+	Resign(ctx context.Context) error
+	// Leader returns the value currently holding leadership, if any.
+	Leader(ctx context.Context) (string, error)
+	// Observe streams the identity of the current leader every time it changes.
+	Observe(ctx context.Context) <-chan string
+}
+
+// WatchEvent is a single raw change notification for a key, as delivered on
+// the channel returned by Backend.Watch. Beyond whether the key was deleted
+// it is deliberately untyped (Added vs Updated is for the Informer layer to
+// decide, by comparing against its cache) since a watch event alone can't
+// tell the two apart.
+type WatchEvent struct {
+	Key     string
+	Value   []byte
+	Deleted bool
+}
+
+// Backend abstracts the distributed KV operations Datastore relies on:
+// loading and storing the synced Object, listing and watching keys for
+// changes, and coordinating access across the cluster through locks and
+// leader election.
+//
+// It replaces a direct dependency on staert.KvSource/libkv so Datastore can
+// be backed by a native etcd v3 or Consul client instead of libkv's
+// lowest-common-denominator store.Store.
+type Backend interface {
+	// Get loads the stored value into object.
+	Get(object Object) error
+	// Put stores object.
+	Put(object Object) error
+	// List returns every key currently stored under prefix, for Informer's
+	// LIST+resync.
+	List(prefix string) (map[string][]byte, error)
+	// Watch notifies on the returned channel of every change to a key under
+	// prefix, until stopCh is closed.
+	Watch(prefix string, stopCh <-chan struct{}) (<-chan WatchEvent, error)
+	// NewLock creates a TTL-backed Locker scoped to key.
+	NewLock(key string, value []byte, ttl time.Duration) (Locker, error)
+	// NewElection creates an Election scoped to key.
+	NewElection(key string, value []byte) (Election, error)
+}
+
+// CASBackend is implemented by backends that expose a compare-and-swap
+// write, such as etcd v3's transactions or Consul's check-and-set index.
+// Datastore uses it to avoid serializing every writer behind a single lock;
+// backends that don't implement it (the libkv shim) fall back to the
+// lock-based Begin/Commit path instead.
+type CASBackend interface {
+	Backend
+	// GetIndex behaves like Get but also returns the revision/ModifyIndex
+	// object was read at, for use in a later AtomicPut.
+	GetIndex(object Object) (uint64, error)
+	// AtomicPut stores object only if the current revision still matches
+	// previousIndex. It reports false, with no error, on a mismatch rather
+	// than storing anything; the caller should reload and retry.
+	AtomicPut(object Object, previousIndex uint64) (bool, uint64, error)
+}
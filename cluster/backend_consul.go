@@ -0,0 +1,257 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"golang.org/x/net/context"
+)
+
+var _ CASBackend = (*consulBackend)(nil)
+
+// consulBackend is the native Consul Backend implementation. It builds locks
+// and leader election on top of Consul sessions (TTL-checked, auto-renewed)
+// instead of going through libkv's generic store.Store.
+type consulBackend struct {
+	client *api.Client
+	prefix string
+}
+
+// NewConsulBackend builds a Backend backed by a native Consul client. All
+// keys it manages are rooted at prefix, mirroring staert.KvSource.Prefix.
+func NewConsulBackend(address, prefix string) (Backend, error) {
+	client, err := api.NewClient(&api.Config{Address: address})
+	if err != nil {
+		return nil, err
+	}
+	return &consulBackend{client: client, prefix: prefix}, nil
+}
+
+func (b *consulBackend) objectKey() string {
+	return b.prefix + "/object"
+}
+
+func (b *consulBackend) Get(object Object) error {
+	pair, _, err := b.client.KV().Get(b.objectKey(), nil)
+	if err != nil {
+		return err
+	}
+	if pair == nil {
+		return nil
+	}
+	return json.Unmarshal(pair.Value, object)
+}
+
+func (b *consulBackend) Put(object Object) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.KV().Put(&api.KVPair{Key: b.objectKey(), Value: data}, nil)
+	return err
+}
+
+func (b *consulBackend) GetIndex(object Object) (uint64, error) {
+	pair, _, err := b.client.KV().Get(b.objectKey(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if pair == nil {
+		return 0, nil
+	}
+	if err := json.Unmarshal(pair.Value, object); err != nil {
+		return 0, err
+	}
+	return pair.ModifyIndex, nil
+}
+
+func (b *consulBackend) AtomicPut(object Object, previousIndex uint64) (bool, uint64, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return false, 0, err
+	}
+	pair := &api.KVPair{Key: b.objectKey(), Value: data, ModifyIndex: previousIndex}
+	ok, _, err := b.client.KV().CAS(pair, nil)
+	if err != nil || !ok {
+		return false, 0, err
+	}
+	updated, _, err := b.client.KV().Get(b.objectKey(), nil)
+	if err != nil {
+		return false, 0, err
+	}
+	return true, updated.ModifyIndex, nil
+}
+
+func (b *consulBackend) List(prefix string) (map[string][]byte, error) {
+	pairs, _, err := b.client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]byte, len(pairs))
+	for _, pair := range pairs {
+		result[pair.Key] = pair.Value
+	}
+	return result, nil
+}
+
+// Watch has no native per-key change feed to lean on, so it keeps issuing
+// blocking List queries on prefix and diffs the result against the previous
+// snapshot to synthesize one WatchEvent per added/changed/removed key.
+func (b *consulBackend) Watch(prefix string, stopCh <-chan struct{}) (<-chan WatchEvent, error) {
+	out := make(chan WatchEvent)
+	go func() {
+		defer close(out)
+		var waitIndex uint64
+		previous := map[string][]byte{}
+		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+			pairs, meta, err := b.client.KV().List(prefix, &api.QueryOptions{WaitIndex: waitIndex, WaitTime: 5 * time.Minute})
+			if err != nil {
+				// Consul's blocking query failed (connection blip, leader
+				// election in the Consul cluster, ...): back off and retry.
+				// The error is not reported and the channel stays open.
+				time.Sleep(time.Second)
+				continue
+			}
+			if meta.LastIndex == waitIndex {
+				continue
+			}
+			waitIndex = meta.LastIndex
+			current := make(map[string][]byte, len(pairs))
+			for _, pair := range pairs {
+				current[pair.Key] = pair.Value
+			}
+			for key, value := range current {
+				if old, ok := previous[key]; !ok || string(old) != string(value) {
+					out <- WatchEvent{Key: key, Value: value}
+				}
+			}
+			for key := range previous {
+				if _, ok := current[key]; !ok {
+					out <- WatchEvent{Key: key, Deleted: true}
+				}
+			}
+			previous = current
+		}
+	}()
+	return out, nil
+}
+
+func (b *consulBackend) NewLock(key string, value []byte, ttl time.Duration) (Locker, error) {
+	lock, err := b.client.LockOpts(&api.LockOptions{
+		Key:          key,
+		Value:        value,
+		SessionTTL:   ttl.String(),
+		MonitorRetry: 3,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &consulLocker{lock: lock}, nil
+}
+
+func (b *consulBackend) NewElection(key string, value []byte) (Election, error) {
+	return &consulElection{client: b.client, key: key, value: value}, nil
+}
+
+type consulLocker struct {
+	lock   *api.Lock
+	stopCh chan struct{}
+}
+
+func (l *consulLocker) Lock(stopCh chan struct{}) (<-chan struct{}, error) {
+	l.stopCh = stopCh
+	return l.lock.Lock(stopCh)
+}
+
+func (l *consulLocker) Unlock() error {
+	return l.lock.Unlock()
+}
+
+// consulElection builds leader election on top of a session-held key: the
+// campaigning node blocks trying to acquire lock, and Leader/Observe read the
+// key's value back (Observe via the same blocking-query mechanism Watch
+// uses); a key no session holds reports no leader (""). Consul
+// has no native election primitive equivalent to etcd's concurrency.Election.
+type consulElection struct {
+	client *api.Client
+	key    string
+	value  []byte
+	lock   *api.Lock
+}
+
+func (e *consulElection) Campaign(ctx context.Context) error {
+	lock, err := e.client.LockOpts(&api.LockOptions{Key: e.key, Value: e.value})
+	if err != nil {
+		return err
+	}
+	e.lock = lock
+	stopCh := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(stopCh)
+	}()
+	leaderCh, err := lock.Lock(stopCh)
+	if err != nil {
+		return err
+	}
+	if leaderCh == nil {
+		return fmt.Errorf("consul: lock was shut down before it was acquired")
+	}
+	return nil
+}
+
+func (e *consulElection) Resign(ctx context.Context) error {
+	if e.lock == nil {
+		return nil
+	}
+	return e.lock.Unlock()
+}
+
+func (e *consulElection) Leader(ctx context.Context) (string, error) {
+	pair, _, err := e.client.KV().Get(e.key, nil)
+	if err != nil {
+		return "", err
+	}
+	if pair == nil || pair.Session == "" {
+		return "", nil
+	}
+	return string(pair.Value), nil
+}
+
+func (e *consulElection) Observe(ctx context.Context) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		var waitIndex uint64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			pair, meta, err := e.client.KV().Get(e.key, &api.QueryOptions{WaitIndex: waitIndex, WaitTime: 5 * time.Minute})
+			if err != nil {
+				time.Sleep(time.Second)
+				continue
+			}
+			if meta.LastIndex == waitIndex || pair == nil {
+				waitIndex = meta.LastIndex
+				continue
+			}
+			waitIndex = meta.LastIndex
+			leader := string(pair.Value)
+			if pair.Session == "" {
+				leader = ""
+			}
+			out <- leader
+		}
+	}()
+	return out
+}
@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/containous/staert"
+	"github.com/docker/libkv/store"
+)
+
+// libkvBackend adapts a staert.KvSource (docker/libkv under the hood) to the
+// Backend interface. It is kept around as a legacy shim for etcd v2, ZooKeeper
+// and any other libkv-only store, since libkv itself has no CAS/lease/session
+// primitives to build a native backend on.
+type libkvBackend struct {
+	kv staert.KvSource
+}
+
+// NewLibkvBackend wraps an existing staert.KvSource as a Backend.
+func NewLibkvBackend(kv staert.KvSource) Backend {
+	return &libkvBackend{kv: kv}
+}
+
+func (b *libkvBackend) Get(object Object) error {
+	return b.kv.LoadConfig(object)
+}
+
+func (b *libkvBackend) Put(object Object) error {
+	return b.kv.StoreConfig(object)
+}
+
+func (b *libkvBackend) List(prefix string) (map[string][]byte, error) {
+	pairs, err := b.kv.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]byte, len(pairs))
+	for _, pair := range pairs {
+		result[pair.Key] = pair.Value
+	}
+	return result, nil
+}
+
+func (b *libkvBackend) Watch(prefix string, stopCh <-chan struct{}) (<-chan WatchEvent, error) {
+	kvCh, err := b.kv.WatchTree(prefix, stopCh)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan WatchEvent)
+	go func() {
+		defer close(out)
+		previous := map[string][]byte{}
+		for pairs := range kvCh {
+			// libkv's WatchTree only ever hands back the full, current list
+			// for the tree, so diff it against the previous snapshot to
+			// synthesize one WatchEvent per added/changed/removed key.
+			current := make(map[string][]byte, len(pairs))
+			for _, pair := range pairs {
+				current[pair.Key] = pair.Value
+				if old, ok := previous[pair.Key]; !ok || string(old) != string(pair.Value) {
+					out <- WatchEvent{Key: pair.Key, Value: pair.Value}
+				}
+			}
+			for key := range previous {
+				if _, ok := current[key]; !ok {
+					out <- WatchEvent{Key: key, Deleted: true}
+				}
+			}
+			previous = current
+		}
+	}()
+	return out, nil
+}
+
+func (b *libkvBackend) NewLock(key string, value []byte, ttl time.Duration) (Locker, error) {
+	return b.kv.NewLock(key, &store.LockOptions{TTL: ttl, Value: value})
+}
+
+func (b *libkvBackend) NewElection(key string, value []byte) (Election, error) {
+	return nil, fmt.Errorf("leader election is not supported by the legacy libkv backend, use %s or %s instead", BackendEtcdV3, BackendConsul)
+}
@@ -3,9 +3,7 @@ package cluster
 import (
 	"fmt"
 	"github.com/cenkalti/backoff"
-	"github.com/containous/staert"
 	"github.com/containous/traefik/log"
-	"github.com/docker/libkv/store"
 	"github.com/satori/go.uuid"
 	"golang.org/x/net/context"
 	"sync"
@@ -24,26 +22,46 @@ var _ Store = (*Datastore)(nil)
 
 // Datastore holds a struct synced in a KV store
 type Datastore struct {
-	kv        staert.KvSource
+	backend   Backend
 	ctx       context.Context
 	localLock *sync.RWMutex
 	object    Object
 	meta      *Metadata
+	prefix    string
 	lockKey   string
 	listener  Listener
+	cache     *localCache
+	offline   bool
 }
 
-// NewDataStore creates a Datastore
-func NewDataStore(kvSource staert.KvSource, ctx context.Context, object Object, listener Listener) (*Datastore, error) {
+// NewDataStore creates a Datastore backed by backend. prefix roots every key
+// the Datastore manages (the synced object as well as its lock), mirroring
+// staert.KvSource.Prefix for backends that don't carry one of their own.
+//
+// cacheConfig is optional: pass nil to talk to backend directly with no
+// local fallback. When set, every object Load/Commit successfully sees is
+// mirrored to a local BoltDB file, so a node that can't reach backend at
+// startup can still come up serving its last-known config (cacheConfig.OfflineMode)
+// instead of failing outright.
+func NewDataStore(backend Backend, prefix string, ctx context.Context, object Object, listener Listener, cacheConfig *CacheConfig) (*Datastore, error) {
 	datastore := Datastore{
-		kv:        kvSource,
+		backend:   backend,
 		ctx:       ctx,
 		meta:      &Metadata{},
 		object:    object,
-		lockKey:   kvSource.Prefix + "/lock",
+		prefix:    prefix,
+		lockKey:   prefix + "/lock",
 		localLock: &sync.RWMutex{},
 		listener:  listener,
 	}
+	if cacheConfig != nil {
+		cache, err := newLocalCache(cacheConfig)
+		if err != nil {
+			return nil, err
+		}
+		datastore.cache = cache
+		datastore.offline = cacheConfig.OfflineMode
+	}
 	err := datastore.watchChanges()
 	if err != nil {
 		return nil, err
@@ -51,49 +69,26 @@ func NewDataStore(kvSource staert.KvSource, ctx context.Context, object Object,
 	return &datastore, nil
 }
 
+// watchChanges runs an Informer over the Datastore's whole prefix (the
+// synced object as well as its lock) and reduces every typed delta it
+// produces back down to the legacy behaviour: reload the object and
+// metadata, then call the single-callback Listener, regardless of which key
+// changed or how. Wrapping a reflector-style Informer here, instead of a
+// bare watch-and-reload loop, is what buys resync-on-compaction and
+// coalesced bursts for free.
 func (d *Datastore) watchChanges() error {
-	stopCh := make(chan struct{})
-	kvCh, err := d.kv.Watch(d.lockKey, stopCh)
-	if err != nil {
-		return err
-	}
+	reload := Listener(func(Object) error {
+		return d.reload()
+	})
+	informer := NewInformer(d.backend, d.prefix, adaptListener(d.object, reload))
 	go func() {
 		ctx, cancel := context.WithCancel(d.ctx)
-		operation := func() error {
-			for {
-				select {
-				case <-ctx.Done():
-					stopCh <- struct{}{}
-					return nil
-				case _, ok := <-kvCh:
-					if !ok {
-						cancel()
-						return err
-					}
-					d.localLock.Lock()
-					err := d.kv.LoadConfig(d.object)
-					if err != nil {
-						d.localLock.Unlock()
-						return err
-					}
-					err = d.kv.LoadConfig(d.meta)
-					if err != nil {
-						d.localLock.Unlock()
-						return err
-					}
-					d.localLock.Unlock()
-					// log.Debugf("Datastore object change received: %+v", d.object)
-					if d.listener != nil {
-						err := d.listener(d.object)
-						if err != nil {
-							log.Errorf("Error calling datastore listener: %s", err)
-						}
-					}
-				}
-			}
+		defer cancel()
+		notify := func(err error, t time.Duration) {
+			log.Errorf("Error in watch datastore: %+v, retrying in %s", err, t)
 		}
-		notify := func(err error, time time.Duration) {
-			log.Errorf("Error in watch datastore: %+v, retrying in %s", err, time)
+		operation := func() error {
+			return informer.Run(ctx)
 		}
 		err := backoff.RetryNotify(operation, backoff.NewExponentialBackOff(), notify)
 		if err != nil {
@@ -103,11 +98,70 @@ func (d *Datastore) watchChanges() error {
 	return nil
 }
 
-// Begin creates a transaction with the KV store.
+// reload refreshes the locally cached object and metadata from the backend
+// and, on success, calls the registered Listener with the fresh object.
+func (d *Datastore) reload() error {
+	d.localLock.Lock()
+	err := d.backend.Get(d.object)
+	if err != nil {
+		d.localLock.Unlock()
+		return err
+	}
+	err = d.backend.Get(d.meta)
+	if err != nil {
+		d.localLock.Unlock()
+		return err
+	}
+	if d.cache != nil {
+		if err := d.cache.Store(d.object); err != nil {
+			log.Errorf("Error mirroring object to local cache: %s", err)
+		}
+	}
+	d.localLock.Unlock()
+	// log.Debugf("Datastore object change received: %+v", d.object)
+	if d.listener != nil {
+		if err := d.listener(d.object); err != nil {
+			log.Errorf("Error calling datastore listener: %s", err)
+		}
+	}
+	return nil
+}
+
+// Begin creates a transaction with the KV store. When the backend supports
+// compare-and-swap writes (CASBackend), the transaction is optimistic: no
+// cluster-wide lock is taken, and Commit instead fails with ErrConflict if
+// the object changed remotely since Load. Backends without CAS support fall
+// back to the lock-based path below.
 func (d *Datastore) Begin() (Transaction, error) {
+	if casBackend, ok := d.backend.(CASBackend); ok {
+		return d.beginCAS(casBackend)
+	}
+	return d.beginLocked()
+}
+
+// beginCAS starts an optimistic transaction: it loads the object along with
+// the revision it was read at, and leaves conflict detection to Commit.
+func (d *Datastore) beginCAS(casBackend CASBackend) (Transaction, error) {
+	d.localLock.Lock()
+	defer d.localLock.Unlock()
+	index, err := casBackend.GetIndex(d.object)
+	if err != nil {
+		return nil, fmt.Errorf("Datastore cannot load object for CAS transaction: %v", err)
+	}
+	return &casTransaction{
+		Datastore: d,
+		cas:       casBackend,
+		index:     index,
+	}, nil
+}
+
+// beginLocked starts a transaction with the KV store. d.backend is pinned
+// for the lifetime of the transaction, so competing writers serialize on
+// lockKey before either of them sees the object at all.
+func (d *Datastore) beginLocked() (Transaction, error) {
 	id := uuid.NewV4().String()
 	log.Debugf("Transaction %s begins", id)
-	remoteLock, err := d.kv.NewLock(d.lockKey, &store.LockOptions{TTL: 20 * time.Second, Value: []byte(id)})
+	remoteLock, err := d.backend.NewLock(d.lockKey, []byte(id), 20*time.Second)
 	if err != nil {
 		return nil, err
 	}
@@ -160,13 +214,86 @@ func (d *Datastore) get() *Metadata {
 	return d.meta
 }
 
-// Load load atomically a struct from the KV store
+// backendRetry bounds how long put/atomicPut keep retrying a write against
+// an unreachable backend: the local cache's MaxLockTime if one is
+// configured, otherwise backend.Put/AtomicPut is tried exactly once.
+func (d *Datastore) backendRetry() backoff.BackOff {
+	if d.cache == nil {
+		return &backoff.StopBackOff{}
+	}
+	ebo := backoff.NewExponentialBackOff()
+	ebo.MaxElapsedTime = d.cache.maxLockTime
+	return ebo
+}
+
+// put writes object to the backend, retrying while the remote backend is
+// unreachable (bounded by the cache's MaxLockTime), and mirrors it to the
+// local cache on success.
+func (d *Datastore) put(object Object) error {
+	operation := func() error {
+		return d.backend.Put(object)
+	}
+	notify := func(err error, t time.Duration) {
+		log.Errorf("Cannot reach cluster backend (%v), retrying write in %s", err, t)
+	}
+	if err := backoff.RetryNotify(operation, d.backendRetry(), notify); err != nil {
+		return err
+	}
+	if d.cache != nil {
+		if cacheErr := d.cache.Store(object); cacheErr != nil {
+			log.Errorf("Error mirroring object to local cache: %s", cacheErr)
+		}
+	}
+	return nil
+}
+
+// atomicPut is the CAS counterpart to put: it retries every error AtomicPut
+// returns, but never a conflict (ok == false, err == nil), since retrying a
+// conflict blindly would just clobber whoever won the race.
+func (d *Datastore) atomicPut(cas CASBackend, object Object, previousIndex uint64) (bool, uint64, error) {
+	var ok bool
+	var newIndex uint64
+	operation := func() error {
+		var err error
+		ok, newIndex, err = cas.AtomicPut(object, previousIndex)
+		return err
+	}
+	notify := func(err error, t time.Duration) {
+		log.Errorf("Cannot reach cluster backend (%v), retrying write in %s", err, t)
+	}
+	if err := backoff.RetryNotify(operation, d.backendRetry(), notify); err != nil {
+		return false, 0, err
+	}
+	if ok && d.cache != nil {
+		if cacheErr := d.cache.Store(object); cacheErr != nil {
+			log.Errorf("Error mirroring object to local cache: %s", cacheErr)
+		}
+	}
+	return ok, newIndex, nil
+}
+
+// Load load atomically a struct from the KV store. If a local cache is
+// configured with OfflineMode and the backend is unreachable, Load falls
+// back to the last object the cache saw instead of failing outright, so an
+// isolated node can still come up serving its last-known config.
 func (d *Datastore) Load() (Object, error) {
 	d.localLock.Lock()
 	defer d.localLock.Unlock()
-	err := d.kv.LoadConfig(d.object)
+	err := d.backend.Get(d.object)
 	if err != nil {
-		return nil, err
+		if d.cache == nil || !d.offline {
+			return nil, err
+		}
+		log.Errorf("Cannot reach cluster backend (%v), falling back to local cache", err)
+		if cacheErr := d.cache.Load(d.object); cacheErr != nil {
+			return nil, err
+		}
+		return d.object, nil
+	}
+	if d.cache != nil {
+		if err := d.cache.Store(d.object); err != nil {
+			log.Errorf("Error mirroring object to local cache: %s", err)
+		}
 	}
 	return d.object, nil
 }
@@ -182,7 +309,7 @@ var _ Transaction = (*datastoreTransaction)(nil)
 
 type datastoreTransaction struct {
 	*Datastore
-	remoteLock store.Locker
+	remoteLock Locker
 	dirty      bool
 	id         string
 }
@@ -194,7 +321,7 @@ func (s *datastoreTransaction) Commit(object Object) error {
 	if s.dirty {
 		return fmt.Errorf("Transaction already used. Please begin a new one.")
 	}
-	err := s.kv.StoreConfig(object)
+	err := s.put(object)
 	if err != nil {
 		return err
 	}
@@ -209,4 +336,50 @@ func (s *datastoreTransaction) Commit(object Object) error {
 	// log.Debugf("Datastore object saved: %+v", s.object)
 	log.Debugf("Transaction commited %s", s.id)
 	return nil
-}
\ No newline at end of file
+}
+
+// ErrConflict is returned by an optimistic transaction's Commit when the
+// object changed remotely since it was loaded. The caller should reload the
+// object with a fresh Begin and retry its update.
+type ErrConflict struct {
+	Key string
+}
+
+func (e *ErrConflict) Error() string {
+	return fmt.Sprintf("conflicting update on %s: object was changed by another writer since Load, retry with fresh state", e.Key)
+}
+
+var _ Transaction = (*casTransaction)(nil)
+
+// casTransaction is the optimistic counterpart to datastoreTransaction: it
+// holds no cluster-wide lock, instead relying on the backend's
+// compare-and-swap write to detect (and fail on) concurrent writers.
+type casTransaction struct {
+	*Datastore
+	cas   CASBackend
+	index uint64
+	dirty bool
+}
+
+// Commit stores object with AtomicPut, failing with ErrConflict rather than
+// overwriting a concurrent writer's update.
+func (s *casTransaction) Commit(object Object) error {
+	s.localLock.Lock()
+	defer s.localLock.Unlock()
+	if s.dirty {
+		return fmt.Errorf("Transaction already used. Please begin a new one.")
+	}
+	ok, newIndex, err := s.atomicPut(s.cas, object, s.index)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &ErrConflict{Key: s.lockKey}
+	}
+
+	s.Datastore.object = object
+	s.index = newIndex
+	s.dirty = true
+	log.Debugf("CAS transaction commited")
+	return nil
+}
@@ -0,0 +1,227 @@
+package cluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/containous/traefik/log"
+	"golang.org/x/net/context"
+)
+
+// DeltaType identifies the kind of change a Delta carries.
+type DeltaType int
+
+const (
+	// Added is emitted for a key that didn't exist in the local cache before.
+	Added DeltaType = iota
+	// Updated is emitted for a key whose value changed.
+	Updated
+	// Deleted is emitted for a key that was removed.
+	Deleted
+	// Sync is emitted for every surviving key during a full LIST+resync,
+	// whether or not its value actually changed, so listeners can reconcile
+	// state they may have missed while the watch was down.
+	Sync
+)
+
+// Delta is a single typed change surfaced by an Informer, carrying both the
+// previous and current value so listeners don't have to re-fetch or diff
+// anything themselves.
+type Delta struct {
+	Type DeltaType
+	Key  string
+	Old  []byte
+	New  []byte
+}
+
+// InformerListener receives typed deltas from an Informer. Any field may be
+// left nil.
+type InformerListener struct {
+	OnAdd    func(key string, new []byte)
+	OnUpdate func(key string, old, new []byte)
+	OnDelete func(key string, old []byte)
+}
+
+// notify dispatches a single Delta to whichever callback matches its Type.
+func (l InformerListener) notify(d Delta) {
+	switch d.Type {
+	case Added:
+		if l.OnAdd != nil {
+			l.OnAdd(d.Key, d.New)
+		}
+	case Updated, Sync:
+		if l.OnUpdate != nil {
+			l.OnUpdate(d.Key, d.Old, d.New)
+		}
+	case Deleted:
+		if l.OnDelete != nil {
+			l.OnDelete(d.Key, d.Old)
+		}
+	}
+}
+
+// adaptListener turns a plain Listener into an InformerListener that calls
+// back with object on every delta, matching Datastore's pre-Informer
+// behaviour where any change, regardless of type, triggers a full reload.
+func adaptListener(object Object, listener Listener) InformerListener {
+	notify := func() {
+		if listener == nil {
+			return
+		}
+		if err := listener(object); err != nil {
+			log.Errorf("Error calling datastore listener: %s", err)
+		}
+	}
+	return InformerListener{
+		OnAdd:    func(key string, new []byte) { notify() },
+		OnUpdate: func(key string, old, new []byte) { notify() },
+		OnDelete: func(key string, old []byte) { notify() },
+	}
+}
+
+// Informer mirrors client-go's reflector/DeltaFIFO: it keeps a local cache
+// of every key under prefix, turns the backend's raw watch notifications
+// into typed Added/Updated/Deleted deltas carrying both the previous and
+// current value, coalesces bursts of notifications for the same key, and
+// falls back to a full LIST+resync (emitting Sync for every surviving key)
+// whenever the watch channel closes or the backend's watch revision was
+// compacted away.
+type Informer struct {
+	backend        Backend
+	prefix         string
+	coalesceWindow time.Duration
+	cache          map[string][]byte
+	listener       InformerListener
+}
+
+// NewInformer creates an Informer watching every key under prefix.
+func NewInformer(backend Backend, prefix string, listener InformerListener) *Informer {
+	return &Informer{
+		backend:        backend,
+		prefix:         prefix,
+		coalesceWindow: 50 * time.Millisecond,
+		cache:          map[string][]byte{},
+		listener:       listener,
+	}
+}
+
+// Run performs an initial LIST+resync and then watches prefix until ctx is
+// cancelled, resyncing again whenever the watch is interrupted.
+//
+// A single goroutine translates ctx's cancellation into closing whichever
+// stopCh is current for the whole lifetime of Run, instead of spawning one
+// per watch attempt: ctx only ever fires once, so a fresh per-iteration
+// goroutine would just pile up blocked on <-ctx.Done() for as long as Run
+// keeps resyncing, leaking one per resync.
+func (i *Informer) Run(ctx context.Context) error {
+	if err := i.resync(); err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	stopCh := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		mu.Lock()
+		close(stopCh)
+		mu.Unlock()
+	}()
+
+	for {
+		mu.Lock()
+		currentStopCh := stopCh
+		mu.Unlock()
+
+		watchCh, err := i.backend.Watch(i.prefix, currentStopCh)
+		if err != nil {
+			return err
+		}
+		i.drain(watchCh)
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		// The watch channel closed: the connection blipped, or the backend
+		// reported our watch revision was compacted away. Either way, a
+		// resync is the only way to be sure we haven't missed a delta.
+		log.Debugf("Informer watch on %s ended, resyncing", i.prefix)
+		if err := i.resync(); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		stopCh = make(chan struct{})
+		mu.Unlock()
+	}
+}
+
+// drain applies watch events to the cache as they arrive, coalescing bursts
+// that touch the same key within coalesceWindow into a single delta.
+func (i *Informer) drain(watchCh <-chan WatchEvent) {
+	pending := map[string]WatchEvent{}
+	timer := time.NewTimer(i.coalesceWindow)
+	defer timer.Stop()
+	flush := func() {
+		for key, ev := range pending {
+			i.apply(ev.Key, ev.Value, ev.Deleted)
+			delete(pending, key)
+		}
+	}
+	for {
+		select {
+		case ev, ok := <-watchCh:
+			if !ok {
+				flush()
+				return
+			}
+			pending[ev.Key] = ev
+			timer.Reset(i.coalesceWindow)
+		case <-timer.C:
+			flush()
+			timer.Reset(i.coalesceWindow)
+		}
+	}
+}
+
+// apply reconciles a single key's change against the cache and emits the
+// matching Delta.
+func (i *Informer) apply(key string, value []byte, deleted bool) {
+	old, existed := i.cache[key]
+	switch {
+	case deleted:
+		if !existed {
+			return
+		}
+		delete(i.cache, key)
+		i.listener.notify(Delta{Type: Deleted, Key: key, Old: old})
+	case !existed:
+		i.cache[key] = value
+		i.listener.notify(Delta{Type: Added, Key: key, New: value})
+	default:
+		i.cache[key] = value
+		i.listener.notify(Delta{Type: Updated, Key: key, Old: old, New: value})
+	}
+}
+
+// resync performs a full LIST of prefix and reconciles the local cache
+// against it, emitting Sync for every surviving key and Deleted for
+// anything that dropped out while the watch was down.
+func (i *Informer) resync() error {
+	current, err := i.backend.List(i.prefix)
+	if err != nil {
+		return err
+	}
+	for key, old := range i.cache {
+		if _, ok := current[key]; !ok {
+			delete(i.cache, key)
+			i.listener.notify(Delta{Type: Deleted, Key: key, Old: old})
+		}
+	}
+	for key, value := range current {
+		old := i.cache[key]
+		i.cache[key] = value
+		i.listener.notify(Delta{Type: Sync, Key: key, Old: old, New: value})
+	}
+	return nil
+}
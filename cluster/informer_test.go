@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordingListener wraps an InformerListener and appends every Delta it
+// sees to deltas, so tests can assert on the exact sequence emitted.
+func recordingListener() (InformerListener, *[]Delta) {
+	deltas := &[]Delta{}
+	return InformerListener{
+		OnAdd: func(key string, new []byte) {
+			*deltas = append(*deltas, Delta{Type: Added, Key: key, New: new})
+		},
+		OnUpdate: func(key string, old, new []byte) {
+			*deltas = append(*deltas, Delta{Type: Updated, Key: key, Old: old, New: new})
+		},
+		OnDelete: func(key string, old []byte) {
+			*deltas = append(*deltas, Delta{Type: Deleted, Key: key, Old: old})
+		},
+	}, deltas
+}
+
+func newTestInformer(listener InformerListener) *Informer {
+	return &Informer{
+		prefix:         "/test",
+		coalesceWindow: 50 * time.Millisecond,
+		cache:          map[string][]byte{},
+		listener:       listener,
+	}
+}
+
+func TestInformerApplyAdd(t *testing.T) {
+	listener, deltas := recordingListener()
+	i := newTestInformer(listener)
+
+	i.apply("/test/a", []byte("v1"), false)
+
+	want := []Delta{{Type: Added, Key: "/test/a", New: []byte("v1")}}
+	if !reflect.DeepEqual(*deltas, want) {
+		t.Fatalf("deltas = %+v, want %+v", *deltas, want)
+	}
+	if got := i.cache["/test/a"]; string(got) != "v1" {
+		t.Fatalf("cache[/test/a] = %q, want v1", got)
+	}
+}
+
+func TestInformerApplyUpdate(t *testing.T) {
+	listener, deltas := recordingListener()
+	i := newTestInformer(listener)
+	i.cache["/test/a"] = []byte("v1")
+
+	i.apply("/test/a", []byte("v2"), false)
+
+	want := []Delta{{Type: Updated, Key: "/test/a", Old: []byte("v1"), New: []byte("v2")}}
+	if !reflect.DeepEqual(*deltas, want) {
+		t.Fatalf("deltas = %+v, want %+v", *deltas, want)
+	}
+	if got := i.cache["/test/a"]; string(got) != "v2" {
+		t.Fatalf("cache[/test/a] = %q, want v2", got)
+	}
+}
+
+func TestInformerApplyDelete(t *testing.T) {
+	listener, deltas := recordingListener()
+	i := newTestInformer(listener)
+	i.cache["/test/a"] = []byte("v1")
+
+	i.apply("/test/a", nil, true)
+
+	want := []Delta{{Type: Deleted, Key: "/test/a", Old: []byte("v1")}}
+	if !reflect.DeepEqual(*deltas, want) {
+		t.Fatalf("deltas = %+v, want %+v", *deltas, want)
+	}
+	if _, ok := i.cache["/test/a"]; ok {
+		t.Fatalf("cache still holds /test/a after delete")
+	}
+}
+
+func TestInformerApplyDeleteOfUnknownKeyIsNoop(t *testing.T) {
+	listener, deltas := recordingListener()
+	i := newTestInformer(listener)
+
+	i.apply("/test/a", nil, true)
+
+	if len(*deltas) != 0 {
+		t.Fatalf("deltas = %+v, want none for deleting a key the cache never saw", *deltas)
+	}
+}
+
+// fakeListBackend is a minimal Backend whose List returns a fixed snapshot;
+// resync is the only method under test here, so every other method is
+// unused.
+type fakeListBackend struct {
+	Backend
+	snapshot map[string][]byte
+}
+
+func (b *fakeListBackend) List(prefix string) (map[string][]byte, error) {
+	return b.snapshot, nil
+}
+
+func TestInformerResync(t *testing.T) {
+	listener, deltas := recordingListener()
+	i := newTestInformer(listener)
+	i.backend = &fakeListBackend{snapshot: map[string][]byte{
+		"/test/a": []byte("v1"),
+		"/test/b": []byte("v2"),
+	}}
+	i.cache["/test/a"] = []byte("v0")
+	i.cache["/test/gone"] = []byte("stale")
+
+	if err := i.resync(); err != nil {
+		t.Fatalf("resync() error = %v", err)
+	}
+
+	byKey := map[string]Delta{}
+	for _, d := range *deltas {
+		byKey[d.Key] = d
+	}
+
+	// Sync and Updated both dispatch through the single OnUpdate callback
+	// (InformerListener.notify), so that's as fine-grained as a listener can
+	// observe: assert the old/new values it delivers, not a Type it has no
+	// way to tell apart from a plain update.
+	if d, ok := byKey["/test/gone"]; !ok || d.Type != Deleted || string(d.Old) != "stale" {
+		t.Fatalf("/test/gone delta = %+v, want Deleted with Old=stale", d)
+	}
+	if d, ok := byKey["/test/a"]; !ok || d.Type != Updated || string(d.Old) != "v0" || string(d.New) != "v1" {
+		t.Fatalf("/test/a delta = %+v, want OnUpdate v0->v1", d)
+	}
+	if d, ok := byKey["/test/b"]; !ok || d.Type != Updated || d.Old != nil || string(d.New) != "v2" {
+		t.Fatalf("/test/b delta = %+v, want OnUpdate nil->v2", d)
+	}
+
+	if got := i.cache["/test/a"]; string(got) != "v1" {
+		t.Fatalf("cache[/test/a] = %q, want v1", got)
+	}
+	if _, ok := i.cache["/test/gone"]; ok {
+		t.Fatalf("cache still holds /test/gone after resync")
+	}
+}
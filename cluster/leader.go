@@ -0,0 +1,247 @@
+package cluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/containous/traefik/log"
+	"github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+)
+
+// LeaderState describes a transition in this node's leadership status, as
+// delivered on the channel returned by Leader.Campaign.
+type LeaderState int
+
+const (
+	// Elected is sent when this node becomes the active leader.
+	Elected LeaderState = iota
+	// Demoted is sent when this node loses leadership, voluntarily or not.
+	Demoted
+)
+
+// OnElected is called once this node becomes leader.
+type OnElected func()
+
+// OnDemoted is called once this node stops being leader.
+type OnDemoted func()
+
+// Leader wraps a Backend's Election to expose "who is the active leader
+// right now" as a first-class primitive, for singleton work such as ACME
+// renewals, metrics scraping or provider polling. Unlike Datastore.Begin,
+// which at most takes a short-lived per-transaction lock, a Leader holds
+// leadership for as long as its underlying lease/session stays alive and
+// notifies subscribers when that changes.
+type Leader struct {
+	id        string
+	key       string
+	backend   Backend
+	ctx       context.Context
+	cancel    context.CancelFunc
+	onElected OnElected
+	onDemoted OnDemoted
+
+	// mu guards election and leader: Campaign's goroutine writes both, while
+	// IsLeader, Resign and Observe are meant to be called from whichever
+	// goroutine is using the elected node as a singleton (ACME renewals,
+	// metrics scraping, provider polling, ...).
+	mu       sync.Mutex
+	election Election
+	leader   bool
+}
+
+// NewLeader creates a Leader that campaigns for key using backend's election
+// primitive. id identifies this node and is the value observers will see
+// once it wins leadership; if empty a random id is generated.
+func NewLeader(ctx context.Context, backend Backend, key, id string) (*Leader, error) {
+	if id == "" {
+		id = uuid.NewV4().String()
+	}
+	election, err := backend.NewElection(key, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	leaderCtx, cancel := context.WithCancel(ctx)
+	return &Leader{
+		id:       id,
+		key:      key,
+		backend:  backend,
+		election: election,
+		ctx:      leaderCtx,
+		cancel:   cancel,
+	}, nil
+}
+
+// OnElected registers a callback invoked every time this node is elected leader.
+func (l *Leader) OnElected(cb OnElected) {
+	l.onElected = cb
+}
+
+// OnDemoted registers a callback invoked every time this node loses leadership.
+func (l *Leader) OnDemoted(cb OnDemoted) {
+	l.onDemoted = cb
+}
+
+// Campaign starts campaigning for leadership and returns a channel of
+// LeaderState transitions. It keeps re-campaigning for as long as l's
+// context is alive, so a lost connection to the backend results in a
+// Demoted followed by a fresh Elected once the node regains leadership,
+// instead of leaving the caller stuck.
+//
+// Every campaign attempt starts from a freshly dialed election: a session
+// that just failed (an expired etcd lease, a dropped Consul session, ...)
+// would otherwise never succeed again, so retrying on it would spin
+// forever without recovering. Failures back off exponentially instead of
+// busy-looping.
+func (l *Leader) Campaign(ctx context.Context) <-chan LeaderState {
+	stateCh := make(chan LeaderState)
+	go func() {
+		defer close(stateCh)
+		ebo := backoff.NewExponentialBackOff()
+		// Once MaxElapsedTime has passed NextBackOff returns backoff.Stop;
+		// keep waiting MaxInterval between attempts instead.
+		nextBackOff := func() time.Duration {
+			if d := ebo.NextBackOff(); d != backoff.Stop {
+				return d
+			}
+			return ebo.MaxInterval
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.ctx.Done():
+				return
+			default:
+			}
+			election, err := l.renewElection()
+			if err != nil {
+				log.Errorf("Error creating election for %s: %s", l.key, err)
+				if !l.sleep(ctx, nextBackOff()) {
+					return
+				}
+				continue
+			}
+			if err := election.Campaign(ctx); err != nil {
+				log.Errorf("Error campaigning for leadership of %s: %s", l.key, err)
+				if !l.sleep(ctx, nextBackOff()) {
+					return
+				}
+				continue
+			}
+			ebo.Reset()
+			l.setLeader(true)
+			if l.onElected != nil {
+				l.onElected()
+			}
+			select {
+			case stateCh <- Elected:
+			case <-ctx.Done():
+				return
+			case <-l.ctx.Done():
+				return
+			}
+			l.waitDemoted(ctx, election, stateCh)
+		}
+	}()
+	return stateCh
+}
+
+// renewElection dials a fresh Election (and therefore a fresh lease/session)
+// from backend, so every campaign attempt starts from a session that is
+// known to be alive rather than retrying on one that just failed.
+func (l *Leader) renewElection() (Election, error) {
+	election, err := l.backend.NewElection(l.key, []byte(l.id))
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	l.election = election
+	l.mu.Unlock()
+	return election, nil
+}
+
+// currentElection returns the Election currently in use, for Resign and Observe.
+func (l *Leader) currentElection() Election {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.election
+}
+
+// setLeader updates whether this node currently holds leadership.
+func (l *Leader) setLeader(leader bool) {
+	l.mu.Lock()
+	l.leader = leader
+	l.mu.Unlock()
+}
+
+// sleep waits for d, or for either context to be cancelled, and reports
+// whether it waited out the full delay.
+func (l *Leader) sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-l.ctx.Done():
+		return false
+	}
+}
+
+// waitDemoted blocks until the leadership session ends (voluntary Resign,
+// connection loss, ...), then reports the Demoted transition.
+func (l *Leader) waitDemoted(ctx context.Context, election Election, stateCh chan<- LeaderState) {
+	observeCh := election.Observe(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.ctx.Done():
+			return
+		case leader, ok := <-observeCh:
+			if ok && leader == l.id {
+				continue
+			}
+			l.setLeader(false)
+			if l.onDemoted != nil {
+				l.onDemoted()
+			}
+			select {
+			case stateCh <- Demoted:
+			case <-ctx.Done():
+			case <-l.ctx.Done():
+			}
+			return
+		}
+	}
+}
+
+// Resign voluntarily gives up leadership.
+func (l *Leader) Resign() error {
+	return l.currentElection().Resign(l.ctx)
+}
+
+// IsLeader reports whether this node currently holds leadership.
+func (l *Leader) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leader
+}
+
+// Observe returns the id of the current leader every time it changes.
+func (l *Leader) Observe() <-chan string {
+	return l.currentElection().Observe(l.ctx)
+}
+
+// Stop ends the campaign and releases any held leadership.
+func (l *Leader) Stop() {
+	if l.IsLeader() {
+		if err := l.Resign(); err != nil {
+			log.Errorf("Error resigning leadership of %s: %s", l.key, err)
+		}
+	}
+	l.cancel()
+}